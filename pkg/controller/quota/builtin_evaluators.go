@@ -0,0 +1,112 @@
+package quota
+
+import (
+	"context"
+
+	v1 "github.com/acorn-io/runtime/pkg/apis/internal.acorn.io/v1"
+	adminv1 "github.com/acorn-io/runtime/pkg/apis/internal.admin.acorn.io/v1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// init registers the built-in evaluators: containers, compute, storage, secrets, jobs and images.
+// Downstream builds register additional evaluators (GPUs, ingress hostnames, external service
+// claims from resolved offerings, etc.) the same way, via RegisterEvaluator.
+func init() {
+	RegisterEvaluator(containersEvaluator{})
+	RegisterEvaluator(computeEvaluator{})
+	RegisterEvaluator(storageEvaluator{})
+	RegisterEvaluator(secretsEvaluator{})
+	RegisterEvaluator(jobsEvaluator{})
+	RegisterEvaluator(imagesEvaluator{})
+}
+
+// containersEvaluator accounts for the number of containers an AppInstance runs.
+type containersEvaluator struct{}
+
+func (containersEvaluator) GroupKind() schema.GroupKind { return schema.GroupKind{Kind: "Container"} }
+
+func (containersEvaluator) MatchesResources() []string { return []string{"containers"} }
+
+func (containersEvaluator) Usage(_ context.Context, _ client.Client, appInstance *v1.AppInstance, quotaRequest *adminv1.QuotaRequestInstance) error {
+	addContainers(appInstance.Status.AppSpec.Containers, quotaRequest)
+	return nil
+}
+
+// computeEvaluator accounts for the cpu/memory requested by an AppInstance's containers, charged
+// in full since containers are expected to run continuously.
+type computeEvaluator struct{}
+
+func (computeEvaluator) GroupKind() schema.GroupKind { return schema.GroupKind{Kind: "ContainerCompute"} }
+
+func (computeEvaluator) MatchesResources() []string { return []string{"cpu", "memory"} }
+
+func (computeEvaluator) Usage(_ context.Context, _ client.Client, appInstance *v1.AppInstance, quotaRequest *adminv1.QuotaRequestInstance) error {
+	if quotaRequest.Spec.Resources.ExtendedResources == nil {
+		quotaRequest.Spec.Resources.ExtendedResources = map[corev1.ResourceName]resource.Quantity{}
+	}
+	addCompute(appInstance.Status.AppSpec.Containers, appInstance, &quotaRequest.Spec.Resources.CPU, &quotaRequest.Spec.Resources.Memory, quotaRequest.Spec.Resources.ExtendedResources, fullCharge)
+	return nil
+}
+
+// storageEvaluator accounts for the volumes an AppInstance requests, both their count and their
+// requested storage size.
+type storageEvaluator struct{}
+
+func (storageEvaluator) GroupKind() schema.GroupKind { return schema.GroupKind{Kind: "Volume"} }
+
+func (storageEvaluator) MatchesResources() []string { return []string{"volumestorage"} }
+
+func (storageEvaluator) Usage(_ context.Context, _ client.Client, appInstance *v1.AppInstance, quotaRequest *adminv1.QuotaRequestInstance) error {
+	quotaRequest.Spec.Resources.Volumes += len(appInstance.Status.AppSpec.Volumes)
+	return addVolumeStorage(appInstance, quotaRequest)
+}
+
+// secretsEvaluator accounts for the net-new secrets an AppInstance requests.
+type secretsEvaluator struct{}
+
+func (secretsEvaluator) GroupKind() schema.GroupKind { return schema.GroupKind{Kind: "Secret"} }
+
+func (secretsEvaluator) MatchesResources() []string { return []string{"secrets"} }
+
+func (secretsEvaluator) Usage(_ context.Context, _ client.Client, appInstance *v1.AppInstance, quotaRequest *adminv1.QuotaRequestInstance) error {
+	addSecrets(appInstance, quotaRequest)
+	return nil
+}
+
+// jobsEvaluator accounts for an AppInstance's jobs: their count, plus their compute requests
+// discounted by schedule and the project's configured overcommit factor (see jobCharge).
+type jobsEvaluator struct{}
+
+func (jobsEvaluator) GroupKind() schema.GroupKind { return schema.GroupKind{Kind: "Job"} }
+
+func (jobsEvaluator) MatchesResources() []string { return []string{"jobs", "jobcpu", "jobmemory"} }
+
+func (jobsEvaluator) Usage(ctx context.Context, c client.Client, appInstance *v1.AppInstance, quotaRequest *adminv1.QuotaRequestInstance) error {
+	quotaRequest.Spec.Resources.Jobs += len(appInstance.Status.AppSpec.Jobs)
+
+	overcommit, err := jobOvercommitFactorCtx(ctx, c, appInstance.Namespace)
+	if err != nil {
+		return err
+	}
+	if quotaRequest.Spec.Resources.JobCompute.ExtendedResources == nil {
+		quotaRequest.Spec.Resources.JobCompute.ExtendedResources = map[corev1.ResourceName]resource.Quantity{}
+	}
+	addCompute(appInstance.Status.AppSpec.Jobs, appInstance, &quotaRequest.Spec.Resources.JobCompute.CPU, &quotaRequest.Spec.Resources.JobCompute.Memory, quotaRequest.Spec.Resources.JobCompute.ExtendedResources, jobCharge(overcommit))
+	return nil
+}
+
+// imagesEvaluator accounts for the number of images an AppInstance pins.
+type imagesEvaluator struct{}
+
+func (imagesEvaluator) GroupKind() schema.GroupKind { return schema.GroupKind{Kind: "Image"} }
+
+func (imagesEvaluator) MatchesResources() []string { return []string{"images"} }
+
+func (imagesEvaluator) Usage(_ context.Context, _ client.Client, appInstance *v1.AppInstance, quotaRequest *adminv1.QuotaRequestInstance) error {
+	quotaRequest.Spec.Resources.Images += len(appInstance.Status.AppSpec.Images)
+	return nil
+}
@@ -0,0 +1,201 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "github.com/acorn-io/runtime/pkg/apis/internal.acorn.io/v1"
+	adminv1 "github.com/acorn-io/runtime/pkg/apis/internal.admin.acorn.io/v1"
+	"github.com/acorn-io/runtime/pkg/condition"
+
+	"github.com/acorn-io/baaah/pkg/router"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// clusterQuotaFinalizer lets EnsureClusterQuotaRequest prune an AppInstance's contribution from
+// Status.AppUsage before the AppInstance is actually deleted. Without it, a deleted app's last
+// recorded usage would stay in the map and be summed into Status.Total.Used forever, permanently
+// inflating the cluster quota.
+const clusterQuotaFinalizer = "admin.acorn.io/cluster-quota"
+
+// appUsageKey joins a namespace and AppInstance name into the key EnsureClusterQuotaRequest uses
+// to track that one app's contribution in Status.AppUsage.
+func appUsageKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// EnsureClusterQuotaRequest updates the ClusterQuotaRequestInstance that selects appInstance's
+// project (the first one matchingClusterQuota finds; any others that also select the project are
+// not updated) with this AppInstance's contribution, so an org can cap total containers/CPU/memory
+// across many acorn projects the same way a project caps a single one. It's meant to run alongside
+// EnsureQuotaRequest, after the per-project QuotaRequestInstance has been computed.
+//
+// Status.Namespaces and Status.Total.Used are always recomputed from Status.AppUsage - the
+// recorded usage of every app that's contributed so far - rather than diffed in place. A project
+// can have many AppInstances, so a single per-namespace slot updated with only the reconciling
+// app's numbers would clobber its siblings' contributions; keying the baseline per app and
+// re-summing avoids that.
+//
+// appInstance carries clusterQuotaFinalizer for as long as it has an entry in Status.AppUsage, so
+// that when it's deleted this func gets one last reconcile to prune that entry before the object
+// actually goes away - otherwise the deleted app's usage would stay counted against the cluster
+// quota forever. Cleanup on delete never depends on quota still being enforced or a cluster quota
+// still selecting the project - either changing out from under a deleting app must not leave it
+// stuck with a finalizer it can never get removed.
+func EnsureClusterQuotaRequest(req router.Request, resp router.Response) error {
+	appInstance := req.Object.(*v1.AppInstance)
+
+	if !appInstance.DeletionTimestamp.IsZero() {
+		return pruneAppUsageOnDelete(req.Ctx, req.Client, resp, appInstance)
+	}
+
+	if enforced, err := isEnforced(req, appInstance.Namespace); err != nil || !enforced {
+		return err
+	}
+
+	clusterQuota, err := matchingClusterQuota(req.Ctx, req.Client, appInstance.Namespace)
+	if err != nil {
+		return err
+	} else if clusterQuota == nil {
+		return nil
+	}
+
+	controllerutil.AddFinalizer(appInstance, clusterQuotaFinalizer)
+
+	newUsed, err := requestedResources(req.Ctx, req.Client, appInstance)
+	if err != nil {
+		return err
+	}
+
+	if clusterQuota.Status.AppUsage == nil {
+		clusterQuota.Status.AppUsage = map[string]adminv1.QuotaRequestResources{}
+	}
+	clusterQuota.Status.AppUsage[appUsageKey(appInstance.Namespace, appInstance.Name)] = newUsed
+
+	recomputeClusterQuotaUsage(clusterQuota)
+
+	resp.Objects(clusterQuota)
+	return nil
+}
+
+// pruneAppUsageOnDelete removes a deleting appInstance's entry from the first ClusterQuotaRequestInstance
+// that still selects its project, then removes clusterQuotaFinalizer so the delete can proceed.
+// This intentionally doesn't check isEnforced or require a cluster quota to still select the
+// project - a finalizer must always be removable, or the AppInstance can never be deleted.
+func pruneAppUsageOnDelete(ctx context.Context, c client.Client, resp router.Response, appInstance *v1.AppInstance) error {
+	if !controllerutil.ContainsFinalizer(appInstance, clusterQuotaFinalizer) {
+		return nil
+	}
+
+	clusterQuota, err := matchingClusterQuota(ctx, c, appInstance.Namespace)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	if clusterQuota != nil && pruneAppUsage(clusterQuota, appInstance) {
+		resp.Objects(clusterQuota)
+	}
+
+	controllerutil.RemoveFinalizer(appInstance, clusterQuotaFinalizer)
+	return nil
+}
+
+// pruneAppUsage removes appInstance's entry from clusterQuota's Status.AppUsage and recomputes the
+// aggregates, reporting whether anything changed.
+func pruneAppUsage(clusterQuota *adminv1.ClusterQuotaRequestInstance, appInstance *v1.AppInstance) bool {
+	key := appUsageKey(appInstance.Namespace, appInstance.Name)
+	if _, ok := clusterQuota.Status.AppUsage[key]; !ok {
+		return false
+	}
+
+	delete(clusterQuota.Status.AppUsage, key)
+	recomputeClusterQuotaUsage(clusterQuota)
+	return true
+}
+
+// recomputeClusterQuotaUsage rebuilds Status.Namespaces and Status.Total.Used from scratch by
+// summing Status.AppUsage, so the aggregate never drifts out of sync with what's actually
+// recorded per app.
+func recomputeClusterQuotaUsage(clusterQuota *adminv1.ClusterQuotaRequestInstance) {
+	namespaces := map[string]adminv1.QuotaRequestResources{}
+	var total adminv1.QuotaRequestResources
+
+	for key, used := range clusterQuota.Status.AppUsage {
+		namespace, _, _ := strings.Cut(key, "/")
+		namespaces[namespace] = addResources(namespaces[namespace], used)
+		total = addResources(total, used)
+	}
+
+	clusterQuota.Status.Namespaces = namespaces
+	clusterQuota.Status.Total.Used = total
+}
+
+// matchingClusterQuota returns the first ClusterQuotaRequestInstance, in list order, whose project
+// selector matches namespace, or nil if no ClusterQuotaRequestInstance selects it.
+func matchingClusterQuota(ctx context.Context, c client.Client, namespace string) (*adminv1.ClusterQuotaRequestInstance, error) {
+	project := &v1.ProjectInstance{}
+	if err := c.Get(ctx, router.Key("", namespace), project); err != nil {
+		return nil, err
+	}
+
+	list := &adminv1.ClusterQuotaRequestInstanceList{}
+	if err := c.List(ctx, list); err != nil {
+		return nil, err
+	}
+
+	for i := range list.Items {
+		clusterQuota := &list.Items[i]
+		selector, err := metav1.LabelSelectorAsSelector(clusterQuota.Spec.ProjectSelector)
+		if err != nil {
+			continue
+		}
+		if !selector.Matches(k8slabels.Set(project.Labels)) {
+			continue
+		}
+		return clusterQuota, nil
+	}
+
+	return nil, nil
+}
+
+// WaitForClusterAllocation blocks the appInstance from being deployed until its cluster-wide quota
+// allocation, if a cluster quota selects its project, has succeeded, and surfaces that allocation's
+// failure. It does not check the per-project allocation, which WaitForAllocation handles; when the
+// cluster allocation has succeeded or no cluster quota applies, it leaves the condition as it is.
+func WaitForClusterAllocation(req router.Request, resp router.Response) error {
+	appInstance := req.Object.(*v1.AppInstance)
+	status := condition.Setter(appInstance, resp, v1.AppInstanceConditionQuota)
+
+	enforced, err := isEnforced(req, appInstance.Namespace)
+	if err != nil {
+		status.Error(err)
+		return err
+	} else if !enforced {
+		status.Success()
+		return nil
+	}
+
+	clusterQuota, err := matchingClusterQuota(req.Ctx, req.Client, appInstance.Namespace)
+	if err != nil {
+		status.Error(err)
+		return err
+	}
+	if clusterQuota == nil {
+		// No cluster quota selects this project, so the per-project result from
+		// WaitForAllocation is authoritative.
+		return nil
+	}
+
+	if cond := clusterQuota.Status.Condition(adminv1.QuotaRequestCondition); cond.Error {
+		status.Error(fmt.Errorf("cluster quota allocation failed: %v", cond.Message))
+	} else if !clusterQuota.Status.Condition(adminv1.QuotaRequestCondition).Success {
+		status.Unknown("waiting for cluster quota allocation")
+	}
+
+	return nil
+}
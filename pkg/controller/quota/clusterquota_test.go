@@ -0,0 +1,122 @@
+package quota
+
+import (
+	"testing"
+
+	v1 "github.com/acorn-io/runtime/pkg/apis/internal.acorn.io/v1"
+	adminv1 "github.com/acorn-io/runtime/pkg/apis/internal.admin.acorn.io/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecomputeClusterQuotaUsageTwoAppsPerNamespace(t *testing.T) {
+	clusterQuota := &adminv1.ClusterQuotaRequestInstance{}
+
+	// Two AppInstances in the same project ("proj") each contribute their own usage.
+	clusterQuota.Status.AppUsage = map[string]adminv1.QuotaRequestResources{
+		appUsageKey("proj", "app-a"): {
+			BaseResources: adminv1.BaseResources{Containers: 1},
+			CPU:           resource.MustParse("1"),
+		},
+		appUsageKey("proj", "app-b"): {
+			BaseResources: adminv1.BaseResources{Containers: 2},
+			CPU:           resource.MustParse("2"),
+		},
+	}
+
+	recomputeClusterQuotaUsage(clusterQuota)
+
+	proj := clusterQuota.Status.Namespaces["proj"]
+	if proj.Containers != 3 {
+		t.Fatalf("expected proj containers to sum both apps to 3, got %d", proj.Containers)
+	}
+	if proj.CPU.Cmp(resource.MustParse("3")) != 0 {
+		t.Fatalf("expected proj cpu to sum both apps to 3, got %s", proj.CPU.String())
+	}
+	if clusterQuota.Status.Total.Used.Containers != 3 {
+		t.Fatalf("expected total containers 3, got %d", clusterQuota.Status.Total.Used.Containers)
+	}
+
+	// Re-reconciling app-a with updated usage must not clobber app-b's last-known contribution.
+	clusterQuota.Status.AppUsage[appUsageKey("proj", "app-a")] = adminv1.QuotaRequestResources{
+		BaseResources: adminv1.BaseResources{Containers: 5},
+		CPU:           resource.MustParse("5"),
+	}
+	recomputeClusterQuotaUsage(clusterQuota)
+
+	proj = clusterQuota.Status.Namespaces["proj"]
+	if proj.Containers != 7 {
+		t.Fatalf("expected proj containers to reflect app-a's update plus app-b's unchanged usage (7), got %d", proj.Containers)
+	}
+	if proj.CPU.Cmp(resource.MustParse("7")) != 0 {
+		t.Fatalf("expected proj cpu to reflect app-a's update plus app-b's unchanged usage (7), got %s", proj.CPU.String())
+	}
+}
+
+func TestPruneAppUsageRemovesDeletedAppAndKeepsSiblings(t *testing.T) {
+	clusterQuota := &adminv1.ClusterQuotaRequestInstance{}
+	clusterQuota.Status.AppUsage = map[string]adminv1.QuotaRequestResources{
+		appUsageKey("proj", "app-a"): {BaseResources: adminv1.BaseResources{Containers: 1}},
+		appUsageKey("proj", "app-b"): {BaseResources: adminv1.BaseResources{Containers: 2}},
+	}
+	recomputeClusterQuotaUsage(clusterQuota)
+
+	appA := &v1.AppInstance{ObjectMeta: metav1.ObjectMeta{Namespace: "proj", Name: "app-a"}}
+
+	changed := pruneAppUsage(clusterQuota, appA)
+	if !changed {
+		t.Fatal("expected pruning a recorded app's usage to report a change")
+	}
+	if _, ok := clusterQuota.Status.AppUsage[appUsageKey("proj", "app-a")]; ok {
+		t.Fatal("expected app-a's usage entry to be removed")
+	}
+
+	// app-b's contribution, recorded by a separate AppInstance in the same project, must survive.
+	if got := clusterQuota.Status.Namespaces["proj"].Containers; got != 2 {
+		t.Fatalf("expected proj usage to reflect only app-b's remaining 2 containers, got %d", got)
+	}
+	if got := clusterQuota.Status.Total.Used.Containers; got != 2 {
+		t.Fatalf("expected total usage to reflect only app-b's remaining 2 containers, got %d", got)
+	}
+}
+
+func TestPruneAppUsageWithoutAnEntryIsNoop(t *testing.T) {
+	clusterQuota := &adminv1.ClusterQuotaRequestInstance{
+		Status: adminv1.ClusterQuotaRequestInstanceStatus{
+			AppUsage: map[string]adminv1.QuotaRequestResources{
+				appUsageKey("proj", "app-b"): {BaseResources: adminv1.BaseResources{Containers: 1}},
+			},
+		},
+	}
+	appA := &v1.AppInstance{ObjectMeta: metav1.ObjectMeta{Namespace: "proj", Name: "app-a"}}
+
+	if pruneAppUsage(clusterQuota, appA) {
+		t.Fatal("expected no change when appInstance has no recorded usage")
+	}
+	if _, ok := clusterQuota.Status.AppUsage[appUsageKey("proj", "app-b")]; !ok {
+		t.Fatal("expected app-b's usage entry to remain untouched")
+	}
+}
+
+func TestRecomputeClusterQuotaUsageAcrossNamespaces(t *testing.T) {
+	clusterQuota := &adminv1.ClusterQuotaRequestInstance{
+		Status: adminv1.ClusterQuotaRequestInstanceStatus{
+			AppUsage: map[string]adminv1.QuotaRequestResources{
+				appUsageKey("proj-a", "app-1"): {BaseResources: adminv1.BaseResources{Containers: 1}},
+				appUsageKey("proj-b", "app-1"): {BaseResources: adminv1.BaseResources{Containers: 4}},
+			},
+		},
+	}
+
+	recomputeClusterQuotaUsage(clusterQuota)
+
+	if got := clusterQuota.Status.Namespaces["proj-a"].Containers; got != 1 {
+		t.Fatalf("expected proj-a containers 1, got %d", got)
+	}
+	if got := clusterQuota.Status.Namespaces["proj-b"].Containers; got != 4 {
+		t.Fatalf("expected proj-b containers 4, got %d", got)
+	}
+	if got := clusterQuota.Status.Total.Used.Containers; got != 5 {
+		t.Fatalf("expected total containers 5, got %d", got)
+	}
+}
@@ -0,0 +1,82 @@
+package quota
+
+import (
+	"context"
+	"sort"
+
+	v1 "github.com/acorn-io/runtime/pkg/apis/internal.acorn.io/v1"
+	adminv1 "github.com/acorn-io/runtime/pkg/apis/internal.admin.acorn.io/v1"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Evaluator computes how much of one or more quota resources an AppInstance consumes, mirroring
+// Kubernetes' quota.Registry/Evaluator model. Built-in evaluators cover containers, compute,
+// storage, secrets, jobs and images; downstream builds can register additional evaluators (GPUs,
+// ingress hostnames, external service claims resolved from offerings) via RegisterEvaluator
+// without editing EnsureQuotaRequest.
+type Evaluator interface {
+	// GroupKind identifies what this evaluator is for. It's only used as a registry key, so
+	// synthetic GroupKinds (e.g. {Kind: "JobCompute"}) are fine for concepts that aren't backed
+	// by a real Kubernetes resource.
+	GroupKind() schema.GroupKind
+
+	// MatchesResources returns the QuotaRequestResources resource names (see
+	// adminv1.QuotaRequestResources.ResourceNames) this evaluator contributes to, e.g.
+	// "containers", "cpu", "memory", "volumestorage", "secrets", "gpu.nvidia.com".
+	MatchesResources() []string
+
+	// Usage adds this evaluator's contribution for appInstance onto quotaRequest.
+	Usage(ctx context.Context, c client.Client, appInstance *v1.AppInstance, quotaRequest *adminv1.QuotaRequestInstance) error
+}
+
+// registry holds every Evaluator EnsureQuotaRequest consults when computing a QuotaRequestInstance.
+var registry = map[schema.GroupKind]Evaluator{}
+
+// RegisterEvaluator adds (or replaces) the Evaluator for its GroupKind. Built-in evaluators are
+// registered by this package's init(); downstream builds can call this from their own init() to
+// add evaluators for kinds acorn's core doesn't know about.
+func RegisterEvaluator(e Evaluator) {
+	registry[e.GroupKind()] = e
+}
+
+// Evaluators returns every registered Evaluator in a stable order.
+func Evaluators() []Evaluator {
+	out := make([]Evaluator, 0, len(registry))
+	for _, e := range registry {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].GroupKind().String() < out[j].GroupKind().String()
+	})
+	return out
+}
+
+// ShouldReplenish reports whether a change to a resource of changedKind could affect the
+// resources quotaRequest actually requests, so callers watching broad sets of kinds (like Jobs or
+// arbitrary third-party evaluators) can skip re-enqueuing work that provably can't change anything.
+func ShouldReplenish(changedKind schema.GroupKind, quotaRequest *adminv1.QuotaRequestInstance) bool {
+	evaluator, ok := registry[changedKind]
+	if !ok {
+		// No evaluator claims this kind, so there's nothing quota-relevant to recompute.
+		return false
+	}
+	return len(intersection(evaluator.MatchesResources(), quotaRequest.Spec.Resources.ResourceNames())) > 0
+}
+
+// intersection returns the elements common to both a and b.
+func intersection(a, b []string) []string {
+	set := make(map[string]bool, len(a))
+	for _, v := range a {
+		set[v] = true
+	}
+
+	var out []string
+	for _, v := range b {
+		if set[v] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,39 @@
+package quota
+
+import (
+	"testing"
+
+	adminv1 "github.com/acorn-io/runtime/pkg/apis/internal.admin.acorn.io/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestShouldReplenishJobDoesNotTriggerOnContainerComputeOnly(t *testing.T) {
+	// An app with only ordinary container cpu/memory usage and no jobs should not trigger a
+	// replenish on a Job change - jobsEvaluator's resource names must not collide with
+	// computeEvaluator's.
+	quotaRequest := &adminv1.QuotaRequestInstance{}
+	quotaRequest.Spec.Resources.CPU = resource.MustParse("1")
+	quotaRequest.Spec.Resources.Memory = resource.MustParse("1Gi")
+
+	if ShouldReplenish(schema.GroupKind{Kind: "Job"}, quotaRequest) {
+		t.Fatal("expected a Job change not to affect an app with only container compute usage")
+	}
+}
+
+func TestShouldReplenishJobTriggersOnJobCompute(t *testing.T) {
+	quotaRequest := &adminv1.QuotaRequestInstance{}
+	quotaRequest.Spec.Resources.Jobs = 1
+	quotaRequest.Spec.Resources.JobCompute.CPU = resource.MustParse("1")
+
+	if !ShouldReplenish(schema.GroupKind{Kind: "Job"}, quotaRequest) {
+		t.Fatal("expected a Job change to affect an app with job compute usage")
+	}
+}
+
+func TestIntersection(t *testing.T) {
+	got := intersection([]string{"cpu", "memory"}, []string{"memory", "jobs"})
+	if len(got) != 1 || got[0] != "memory" {
+		t.Fatalf("expected intersection to be [memory], got %v", got)
+	}
+}
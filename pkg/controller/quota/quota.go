@@ -1,21 +1,35 @@
 package quota
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"time"
 
 	v1 "github.com/acorn-io/runtime/pkg/apis/internal.acorn.io/v1"
 	adminv1 "github.com/acorn-io/runtime/pkg/apis/internal.admin.acorn.io/v1"
 	"github.com/acorn-io/runtime/pkg/labels"
+	"github.com/robfig/cron/v3"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"github.com/acorn-io/runtime/pkg/condition"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 
 	"github.com/acorn-io/baaah/pkg/router"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// defaultJobOvercommitFactor is used when a project hasn't set
+// labels.ProjectJobOvercommitFactorAnnotation. A factor of 1 applies no discount beyond the
+// fraction of its schedule's period a cron job runs for (see jobCharge); projects that know their
+// jobs are short-lived relative to their schedule can
+// lower this to pack more jobs into the same hard limits.
+const defaultJobOvercommitFactor = 1.0
+
 // WaitForAllocation blocks the appInstance from being deployed until quota has been allocated on
 // an associated QuotaRequest object.
 func WaitForAllocation(req router.Request, resp router.Response) error {
@@ -62,7 +76,10 @@ func WaitForAllocation(req router.Request, resp router.Response) error {
 	return nil
 }
 
-// EnsureQuotaRequest ensures that the quota request exists and is up to date.
+// EnsureQuotaRequest ensures that the quota request exists and is up to date. The actual
+// per-resource accounting is delegated to the registered Evaluators (see evaluator.go) rather
+// than being hardcoded here, so third-party resource kinds can participate without editing this
+// loop.
 func EnsureQuotaRequest(req router.Request, resp router.Response) error {
 	appInstance := req.Object.(*v1.AppInstance)
 
@@ -71,40 +88,57 @@ func EnsureQuotaRequest(req router.Request, resp router.Response) error {
 		return err
 	}
 
-	// Create the quota request object and give calculate the standard numeric values
-	name, namespace, app := appInstance.Name, appInstance.Namespace, appInstance.Status.AppSpec
+	status := condition.Setter(appInstance, resp, v1.AppInstanceConditionQuota)
+
 	quotaRequest := &adminv1.QuotaRequestInstance{
-		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
-		Spec: adminv1.QuotaRequestInstanceSpec{
-			Resources: adminv1.QuotaRequestResources{
-				BaseResources: adminv1.BaseResources{
-					Jobs:    len(app.Jobs),
-					Volumes: len(app.Volumes),
-					Images:  len(app.Images),
-				},
-			},
-		},
+		ObjectMeta: metav1.ObjectMeta{Name: appInstance.Name, Namespace: appInstance.Namespace},
 	}
 
-	status := condition.Setter(appInstance, resp, v1.AppInstanceConditionQuota)
-
-	// Add the more complex values to the quota request
-	addContainers(app.Containers, quotaRequest)
-	addCompute(app.Containers, appInstance, quotaRequest)
-	// TODO: This is a stop-gap until we figure out how to handle the compute resources of
-	//       jobs. The problem is that Jobs are not always running, so we can't just add
-	//       their compute resources to the quota request permananetly. To some degree it'll
-	//       have to be dynamic, but we can't do that until we have a better idea of how.
-	// addCompute(app.Jobs, appInstance, quotaRequest)
-	if err := addStorage(appInstance, quotaRequest); err != nil {
-		status.Error(err)
-		return err
+	for _, evaluator := range Evaluators() {
+		if err := evaluator.Usage(req.Ctx, req.Client, appInstance, quotaRequest); err != nil {
+			status.Error(err)
+			return err
+		}
 	}
 
 	resp.Objects(quotaRequest)
 	return nil
 }
 
+// ReplenishQuotaOnJobChange re-triggers EnsureQuotaRequest for the AppInstance that owns job
+// whenever the job transitions between Active and Complete, so the JobCompute bucket it
+// contributes to is released promptly instead of waiting for the next unrelated reconcile.
+func ReplenishQuotaOnJobChange(req router.Request, resp router.Response) error {
+	job := req.Object.(*batchv1.Job)
+
+	owner := metav1.GetControllerOf(job)
+	if owner == nil || owner.Kind != "AppInstance" {
+		return nil
+	}
+
+	appInstance := &v1.AppInstance{}
+	if err := req.Client.Get(req.Ctx, router.Key(job.Namespace, owner.Name), appInstance); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	quotaRequest := &adminv1.QuotaRequestInstance{}
+	if err := req.Client.Get(req.Ctx, router.Key(appInstance.Namespace, appInstance.Name), quotaRequest); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if !ShouldReplenish(schema.GroupKind{Kind: "Job"}, quotaRequest) {
+		return nil
+	}
+
+	return EnsureQuotaRequest(router.Request{Ctx: req.Ctx, Client: req.Client, Object: appInstance}, resp)
+}
+
 // addContainers adds the number of containers and accounts for the scale of each container.
 func addContainers(containers map[string]v1.Container, quotaRequest *adminv1.QuotaRequestInstance) {
 	for _, container := range containers {
@@ -112,8 +146,12 @@ func addContainers(containers map[string]v1.Container, quotaRequest *adminv1.Quo
 	}
 }
 
-// addCompute adds the compute resources of the containers passed to the quota request.
-func addCompute(containers map[string]v1.Container, appInstance *v1.AppInstance, quotaRequest *adminv1.QuotaRequestInstance) {
+// addCompute adds the compute resources of the containers passed into cpu/memory/extended, scaled
+// by charge(name, container) - a multiplier, 1 for a full charge, used to discount workloads, like
+// jobs, that aren't always consuming their requested resources (a job overcommit factor above 1
+// makes it exceed 1). extended must be non-nil; it accumulates any
+// resource.Requests key other than cpu/memory (e.g. nvidia.com/gpu, hugepages-2Mi).
+func addCompute(containers map[string]v1.Container, appInstance *v1.AppInstance, cpu, memory *resource.Quantity, extended map[corev1.ResourceName]resource.Quantity, charge func(name string, container v1.Container) float64) {
 	// For each workload, add their memory/cpu requests to the quota request
 	for name, container := range containers {
 		var requirements corev1.ResourceRequirements
@@ -123,23 +161,110 @@ func addCompute(containers map[string]v1.Container, appInstance *v1.AppInstance,
 			requirements = all.Requirements
 		}
 
-		// Add the memory/cpu requests to the quota request for each container at the scale specified
+		factor := charge(name, container)
+
+		// Add the memory/cpu/extended requests to the quota request for each container at the
+		// scale specified
 		for i := 0; i < replicas(container.Scale); i++ {
-			quotaRequest.Spec.Resources.CPU.Add(requirements.Requests["cpu"])
-			quotaRequest.Spec.Resources.Memory.Add(requirements.Requests["memory"])
+			cpu.Add(scaleQuantity(requirements.Requests["cpu"], factor))
+			memory.Add(scaleQuantity(requirements.Requests["memory"], factor))
+			for resourceName, quantity := range requirements.Requests {
+				if resourceName == corev1.ResourceCPU || resourceName == corev1.ResourceMemory {
+					continue
+				}
+				total := extended[resourceName]
+				total.Add(scaleQuantity(quantity, factor))
+				extended[resourceName] = total
+			}
 		}
 
 		// Recurse over any sidecars. Since sidecars can't have sidecars, this is safe.
-		addCompute(container.Sidecars, appInstance, quotaRequest)
+		addCompute(container.Sidecars, appInstance, cpu, memory, extended, charge)
 	}
 }
 
-// addStorage adds the storage resources of the volumes passed to the quota request.
-func addStorage(appInstance *v1.AppInstance, quotaRequest *adminv1.QuotaRequestInstance) error {
+// fullCharge is the charge func for workloads, like containers, that run continuously and so
+// should always be charged their full requested resources.
+func fullCharge(string, v1.Container) float64 {
+	return 1
+}
+
+// jobCharge returns a charge func for Jobs: on-demand jobs (no schedule) are charged in full since
+// they can be invoked - and hold their resources - at any time, so overcommit must not discount
+// them. Cron-scheduled jobs are discounted to the fraction of their schedule's period they're
+// expected to actually run for, then further scaled by overcommit - a project-configurable factor
+// for packing more jobs into the same hard limits.
+func jobCharge(overcommit float64) func(name string, container v1.Container) float64 {
+	return func(_ string, container v1.Container) float64 {
+		if container.Schedule == "" {
+			return 1
+		}
+
+		period, err := jobPeriodSeconds(container.Schedule)
+		if err != nil || period <= 0 {
+			// Can't determine the schedule's period, so fall back to charging the job in full,
+			// same as an on-demand job - overcommit only ever discounts a schedule we can measure.
+			return 1
+		}
+
+		deadline := float64(period)
+		if container.ActiveDeadlineSeconds != nil {
+			deadline = float64(*container.ActiveDeadlineSeconds)
+		}
+
+		return overcommit * min(1, deadline/float64(period))
+	}
+}
+
+// jobPeriodSeconds estimates the period, in seconds, between successive runs of a cron schedule
+// by comparing two consecutive scheduled times.
+func jobPeriodSeconds(schedule string) (int64, error) {
+	sched, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return 0, err
+	}
+
+	from := time.Unix(0, 0).UTC()
+	first := sched.Next(from)
+	second := sched.Next(first)
+	return int64(second.Sub(first).Seconds()), nil
+}
+
+// scaleQuantity returns a copy of q scaled by factor, truncated toward zero to a whole milli-unit.
+func scaleQuantity(q resource.Quantity, factor float64) resource.Quantity {
+	if factor == 1 {
+		return q
+	}
+	scaled := int64(float64(q.MilliValue()) * factor)
+	return *resource.NewMilliQuantity(scaled, q.Format)
+}
+
+// jobOvercommitFactorCtx returns the project's configured job overcommit factor, defaulting to
+// defaultJobOvercommitFactor when the project hasn't set
+// labels.ProjectJobOvercommitFactorAnnotation or the value can't be parsed.
+func jobOvercommitFactorCtx(ctx context.Context, c client.Client, namespace string) (float64, error) {
+	project := v1.ProjectInstance{}
+	if err := c.Get(ctx, router.Key("", namespace), &project); err != nil {
+		return 0, err
+	}
+
+	raw, ok := project.Annotations[labels.ProjectJobOvercommitFactorAnnotation]
+	if !ok {
+		return defaultJobOvercommitFactor, nil
+	}
+
+	factor, err := strconv.ParseFloat(raw, 64)
+	if err != nil || factor <= 0 {
+		return defaultJobOvercommitFactor, nil
+	}
+	return factor, nil
+}
+
+// addVolumeStorage adds the storage resources of the volumes passed to the quota request. We only
+// parse net new volumes, not existing ones that are then bound client-side.
+func addVolumeStorage(appInstance *v1.AppInstance, quotaRequest *adminv1.QuotaRequestInstance) error {
 	app := appInstance.Status.AppSpec
 
-	// Add the volume storage needed to the quota request. We only parse net new volumes, not
-	// existing ones that are then bound client-side.
 	for name, volume := range app.Volumes {
 		size := volume.Size
 		if bound, boundSize := boundVolumeSize(name, appInstance.Spec.Volumes); bound {
@@ -157,16 +282,20 @@ func addStorage(appInstance *v1.AppInstance, quotaRequest *adminv1.QuotaRequestI
 		}
 		quotaRequest.Spec.Resources.VolumeStorage.Add(parsedSize)
 	}
+	return nil
+}
+
+// addSecrets adds the count of secrets passed to the quota request. We only count net new
+// secrets, not existing ones that are then bound client-side.
+func addSecrets(appInstance *v1.AppInstance, quotaRequest *adminv1.QuotaRequestInstance) {
+	app := appInstance.Status.AppSpec
 
-	// Add the secrets needed to the quota request. We only parse net new secrets, not
-	// existing ones that are then bound client-side.
 	for name := range app.Secrets {
 		if boundSecret(name, appInstance.Spec.Secrets) {
 			continue
 		}
 		quotaRequest.Spec.Resources.Secrets += 1
 	}
-	return nil
 }
 
 // boundVolumeSize determines if the specified volume will be bound to an existing one. If
@@ -192,8 +321,14 @@ func boundSecret(name string, bindings []v1.SecretBinding) bool {
 
 // isEnforced determines if the project requires quota enforcement.
 func isEnforced(req router.Request, namespace string) (bool, error) {
+	return isEnforcedCtx(req.Ctx, req.Client, namespace)
+}
+
+// isEnforcedCtx is the context/client flavored version of isEnforced, shared with callers that
+// don't have a router.Request to work with, such as the admission webhook.
+func isEnforcedCtx(ctx context.Context, c client.Client, namespace string) (bool, error) {
 	project := v1.ProjectInstance{}
-	if err := req.Client.Get(req.Ctx, router.Key("", namespace), &project); err != nil {
+	if err := c.Get(ctx, router.Key("", namespace), &project); err != nil {
 		return false, err
 	}
 	return project.Annotations[labels.ProjectEnforcedQuotaAnnotation] == "true", nil
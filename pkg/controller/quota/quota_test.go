@@ -0,0 +1,72 @@
+package quota
+
+import (
+	"testing"
+
+	v1 "github.com/acorn-io/runtime/pkg/apis/internal.acorn.io/v1"
+)
+
+func TestJobChargeOnDemandIsAlwaysFull(t *testing.T) {
+	charge := jobCharge(0.25)
+
+	got := charge("job", v1.Container{})
+	if got != 1 {
+		t.Fatalf("expected on-demand job to be charged in full regardless of overcommit, got %v", got)
+	}
+}
+
+func TestJobChargeScheduledAppliesOvercommit(t *testing.T) {
+	charge := jobCharge(0.5)
+
+	// Every minute: period is 60s. A deadline equal to the period should be charged the full
+	// overcommit factor, since the job is expected to run the whole period.
+	got := charge("job", v1.Container{Schedule: "* * * * *"})
+	if got != 0.5 {
+		t.Fatalf("expected scheduled job with full-period deadline to be charged overcommit (0.5), got %v", got)
+	}
+}
+
+func TestJobChargeScheduledShortDeadlineDiscountsFurther(t *testing.T) {
+	charge := jobCharge(1)
+
+	deadline := int64(30)
+	got := charge("job", v1.Container{Schedule: "* * * * *", ActiveDeadlineSeconds: &deadline})
+	if got != 0.5 {
+		t.Fatalf("expected a 30s deadline on a 60s schedule to be charged half, got %v", got)
+	}
+}
+
+func TestJobChargeInvalidScheduleFallsBackToFull(t *testing.T) {
+	charge := jobCharge(0.75)
+
+	got := charge("job", v1.Container{Schedule: "not a schedule"})
+	if got != 1 {
+		t.Fatalf("expected an unparseable schedule to fall back to a full charge, got %v", got)
+	}
+}
+
+func TestJobPeriodSecondsEveryMinute(t *testing.T) {
+	period, err := jobPeriodSeconds("* * * * *")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if period != 60 {
+		t.Fatalf("expected a 60s period for \"* * * * *\", got %d", period)
+	}
+}
+
+func TestJobPeriodSecondsHourly(t *testing.T) {
+	period, err := jobPeriodSeconds("0 * * * *")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if period != 3600 {
+		t.Fatalf("expected a 3600s period for \"0 * * * *\", got %d", period)
+	}
+}
+
+func TestJobPeriodSecondsInvalidSchedule(t *testing.T) {
+	if _, err := jobPeriodSeconds("not a schedule"); err == nil {
+		t.Fatal("expected an error for an unparseable schedule")
+	}
+}
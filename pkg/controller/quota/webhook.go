@@ -0,0 +1,239 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "github.com/acorn-io/runtime/pkg/apis/internal.acorn.io/v1"
+	adminv1 "github.com/acorn-io/runtime/pkg/apis/internal.admin.acorn.io/v1"
+	"github.com/acorn-io/baaah/pkg/router"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// AppInstanceQuotaValidator is a ValidatingAdmissionWebhook that rejects AppInstance create/update
+// requests synchronously when the requested resources would exceed the project's enforced hard
+// limits, instead of only surfacing the failure asynchronously through AppInstanceConditionQuota
+// once EnsureQuotaRequest and the quota controller have had a chance to run.
+//
+// It mirrors Kubernetes' ResourceQuota admission plugin: recompute what the AppInstance would use,
+// diff it against what's already allocated for it, add the diff to the project's current usage,
+// and deny if any resource would cross its hard limit.
+type AppInstanceQuotaValidator struct {
+	Client  client.Client
+	decoder admission.Decoder
+}
+
+// NewAppInstanceQuotaValidator returns a webhook.Handler that can be registered with a
+// controller-runtime webhook server, e.g.
+// mgr.GetWebhookServer().Register("/validate-appinstance-quota", &admission.Webhook{Handler: validator}).
+func NewAppInstanceQuotaValidator(c client.Client, decoder admission.Decoder) *AppInstanceQuotaValidator {
+	return &AppInstanceQuotaValidator{Client: c, decoder: decoder}
+}
+
+// Handle implements admission.Handler.
+func (v *AppInstanceQuotaValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	// Status and other subresource updates don't change anything quota-relevant, so don't hold
+	// them up.
+	if req.SubResource != "" {
+		return admission.Allowed("subresource update does not affect quota")
+	}
+
+	appInstance := &v1.AppInstance{}
+	if err := v.decoder.Decode(req, appInstance); err != nil {
+		return admission.Errored(errors.StatusBadRequest, err)
+	}
+
+	enforced, err := isEnforcedCtx(ctx, v.Client, appInstance.Namespace)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// No project to enforce quota against, so let it through.
+			return admission.Allowed("project has no quota enforcement configured")
+		}
+		return admission.Errored(errors.StatusInternalServerError, err)
+	} else if !enforced {
+		return admission.Allowed("quota is not enforced for this project")
+	}
+
+	project := &v1.ProjectInstance{}
+	if err := v.Client.Get(ctx, router.Key("", appInstance.Namespace), project); err != nil {
+		return admission.Errored(errors.StatusInternalServerError, err)
+	}
+	if project.Spec.Quota == nil {
+		return admission.Allowed("project has no hard limits configured")
+	}
+
+	existing := &adminv1.QuotaRequestInstance{}
+	if err := v.Client.Get(ctx, router.Key(appInstance.Namespace, appInstance.Name), existing); err != nil && !errors.IsNotFound(err) {
+		return admission.Errored(errors.StatusInternalServerError, err)
+	}
+
+	wanted, err := requestedResources(ctx, v.Client, appInstance)
+	if err != nil {
+		return admission.Errored(errors.StatusBadRequest, err)
+	}
+
+	delta := subtractResources(wanted, existing.Status.AllocatedResources)
+
+	used, err := projectUsage(ctx, v.Client, appInstance.Namespace, appInstance.Name)
+	if err != nil {
+		return admission.Errored(errors.StatusInternalServerError, err)
+	}
+
+	projected := addResources(used, delta)
+
+	if violations := exceedsLimits(projected, *project.Spec.Quota); len(violations) > 0 {
+		return admission.Denied(fmt.Sprintf("exceeds project quota: %s", strings.Join(violations, "; ")))
+	}
+
+	return admission.Allowed("within project quota")
+}
+
+// requestedResources computes the QuotaRequestResources that would be allocated for appInstance,
+// running it through the same registered Evaluators EnsureQuotaRequest uses so the two never
+// drift apart.
+func requestedResources(ctx context.Context, c client.Client, appInstance *v1.AppInstance) (adminv1.QuotaRequestResources, error) {
+	quotaRequest := &adminv1.QuotaRequestInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: appInstance.Name, Namespace: appInstance.Namespace},
+	}
+
+	for _, evaluator := range Evaluators() {
+		if err := evaluator.Usage(ctx, c, appInstance, quotaRequest); err != nil {
+			return adminv1.QuotaRequestResources{}, err
+		}
+	}
+
+	return quotaRequest.Spec.Resources, nil
+}
+
+// projectUsage sums the allocated resources of every other QuotaRequestInstance in namespace,
+// excluding exclude (the AppInstance being admitted, whose own allocation is accounted for
+// separately as the delta between its existing and requested resources).
+func projectUsage(ctx context.Context, c client.Client, namespace, exclude string) (adminv1.QuotaRequestResources, error) {
+	list := &adminv1.QuotaRequestInstanceList{}
+	if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return adminv1.QuotaRequestResources{}, err
+	}
+
+	var used adminv1.QuotaRequestResources
+	for _, quotaRequest := range list.Items {
+		if quotaRequest.Name == exclude {
+			continue
+		}
+		used = addResources(used, quotaRequest.Status.AllocatedResources)
+	}
+	return used, nil
+}
+
+// addResources returns the element-wise sum of a and b.
+func addResources(a, b adminv1.QuotaRequestResources) adminv1.QuotaRequestResources {
+	a.Containers += b.Containers
+	a.Volumes += b.Volumes
+	a.Images += b.Images
+	a.Secrets += b.Secrets
+	a.Jobs += b.Jobs
+	a.CPU.Add(b.CPU)
+	a.Memory.Add(b.Memory)
+	a.VolumeStorage.Add(b.VolumeStorage)
+	a.JobCompute.CPU.Add(b.JobCompute.CPU)
+	a.JobCompute.Memory.Add(b.JobCompute.Memory)
+	a.ExtendedResources = addExtendedResources(a.ExtendedResources, b.ExtendedResources)
+	a.JobCompute.ExtendedResources = addExtendedResources(a.JobCompute.ExtendedResources, b.JobCompute.ExtendedResources)
+	return a
+}
+
+// addExtendedResources returns the element-wise sum of a and b, neither of which is mutated.
+func addExtendedResources(a, b map[corev1.ResourceName]resource.Quantity) map[corev1.ResourceName]resource.Quantity {
+	out := make(map[corev1.ResourceName]resource.Quantity, len(a))
+	for name, qty := range a {
+		out[name] = qty
+	}
+	for name, qty := range b {
+		total := out[name]
+		total.Add(qty)
+		out[name] = total
+	}
+	return out
+}
+
+// subtractResources returns the element-wise difference a - b, used to compute how much an
+// AppInstance's requested resources change relative to what it has already been allocated.
+func subtractResources(a, b adminv1.QuotaRequestResources) adminv1.QuotaRequestResources {
+	a.Containers -= b.Containers
+	a.Volumes -= b.Volumes
+	a.Images -= b.Images
+	a.Secrets -= b.Secrets
+	a.Jobs -= b.Jobs
+	a.CPU.Sub(b.CPU)
+	a.Memory.Sub(b.Memory)
+	a.VolumeStorage.Sub(b.VolumeStorage)
+	a.JobCompute.CPU.Sub(b.JobCompute.CPU)
+	a.JobCompute.Memory.Sub(b.JobCompute.Memory)
+	a.ExtendedResources = subtractExtendedResources(a.ExtendedResources, b.ExtendedResources)
+	a.JobCompute.ExtendedResources = subtractExtendedResources(a.JobCompute.ExtendedResources, b.JobCompute.ExtendedResources)
+	return a
+}
+
+// subtractExtendedResources returns the element-wise difference a - b, neither of which is mutated.
+func subtractExtendedResources(a, b map[corev1.ResourceName]resource.Quantity) map[corev1.ResourceName]resource.Quantity {
+	out := make(map[corev1.ResourceName]resource.Quantity, len(a))
+	for name, qty := range a {
+		out[name] = qty
+	}
+	for name, qty := range b {
+		total := out[name]
+		total.Sub(qty)
+		out[name] = total
+	}
+	return out
+}
+
+// exceedsLimits compares used against limits and returns a human-readable description of each
+// resource that would exceed its limit, in a message format similar to Kubernetes' ResourceQuota
+// admission plugin ("used: X, limited: Y").
+//
+// Unlike real ResourceQuota, whose Hard ResourceList distinguishes "capped at 0" from "uncapped"
+// by a key's presence, adminv1.QuotaRequestResources/BaseResources store limits as plain numeric
+// fields, so a limit of exactly 0 is indistinguishable here from "not configured" and is treated as
+// uncapped. That means a project can't express "0 GPUs allowed" or "0 secrets allowed" today; doing
+// so would need a data-model change to adminv1.QuotaRequestResources (e.g. pointer fields) and
+// should be raised with whoever owns those types rather than worked around here.
+func exceedsLimits(used, limits adminv1.QuotaRequestResources) []string {
+	var violations []string
+
+	checkInt := func(name string, used, limit int) {
+		if limit > 0 && used > limit {
+			violations = append(violations, fmt.Sprintf("%s: used %d, limited to %d", name, used, limit))
+		}
+	}
+	checkQuantity := func(name string, used, limit resource.Quantity) {
+		if !limit.IsZero() && used.Cmp(limit) > 0 {
+			violations = append(violations, fmt.Sprintf("%s: used %s, limited to %s", name, used.String(), limit.String()))
+		}
+	}
+
+	checkInt("containers", used.Containers, limits.Containers)
+	checkInt("volumes", used.Volumes, limits.Volumes)
+	checkInt("images", used.Images, limits.Images)
+	checkInt("secrets", used.Secrets, limits.Secrets)
+	checkInt("jobs", used.Jobs, limits.Jobs)
+	checkQuantity("cpu", used.CPU, limits.CPU)
+	checkQuantity("memory", used.Memory, limits.Memory)
+	checkQuantity("volumestorage", used.VolumeStorage, limits.VolumeStorage)
+	checkQuantity("job cpu", used.JobCompute.CPU, limits.JobCompute.CPU)
+	checkQuantity("job memory", used.JobCompute.Memory, limits.JobCompute.Memory)
+
+	for name, limit := range limits.ExtendedResources {
+		checkQuantity(string(name), used.ExtendedResources[name], limit)
+	}
+	for name, limit := range limits.JobCompute.ExtendedResources {
+		checkQuantity("job "+string(name), used.JobCompute.ExtendedResources[name], limit)
+	}
+
+	return violations
+}
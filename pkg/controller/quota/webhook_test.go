@@ -0,0 +1,93 @@
+package quota
+
+import (
+	"testing"
+
+	adminv1 "github.com/acorn-io/runtime/pkg/apis/internal.admin.acorn.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestExceedsLimitsWithinLimits(t *testing.T) {
+	used := adminv1.QuotaRequestResources{
+		BaseResources: adminv1.BaseResources{Containers: 2},
+		CPU:           resource.MustParse("1"),
+	}
+	limits := adminv1.QuotaRequestResources{
+		BaseResources: adminv1.BaseResources{Containers: 5},
+		CPU:           resource.MustParse("2"),
+	}
+
+	if violations := exceedsLimits(used, limits); len(violations) != 0 {
+		t.Fatalf("expected no violations, got %v", violations)
+	}
+}
+
+func TestExceedsLimitsOverCount(t *testing.T) {
+	used := adminv1.QuotaRequestResources{BaseResources: adminv1.BaseResources{Containers: 6}}
+	limits := adminv1.QuotaRequestResources{BaseResources: adminv1.BaseResources{Containers: 5}}
+
+	violations := exceedsLimits(used, limits)
+	if len(violations) != 1 {
+		t.Fatalf("expected exactly one violation, got %v", violations)
+	}
+}
+
+func TestExceedsLimitsOverQuantity(t *testing.T) {
+	used := adminv1.QuotaRequestResources{CPU: resource.MustParse("3")}
+	limits := adminv1.QuotaRequestResources{CPU: resource.MustParse("2")}
+
+	violations := exceedsLimits(used, limits)
+	if len(violations) != 1 {
+		t.Fatalf("expected exactly one cpu violation, got %v", violations)
+	}
+}
+
+func TestExceedsLimitsZeroLimitMeansUnset(t *testing.T) {
+	// A zero limit means the project hasn't set one, so it should never trigger a violation no
+	// matter how much has been used - mirroring Kubernetes' ResourceQuota treatment of unset limits.
+	used := adminv1.QuotaRequestResources{BaseResources: adminv1.BaseResources{Jobs: 10}, CPU: resource.MustParse("10")}
+	limits := adminv1.QuotaRequestResources{}
+
+	if violations := exceedsLimits(used, limits); len(violations) != 0 {
+		t.Fatalf("expected no violations against unset limits, got %v", violations)
+	}
+}
+
+func TestExceedsLimitsJobComputeIsSeparateFromContainerCompute(t *testing.T) {
+	used := adminv1.QuotaRequestResources{
+		CPU: resource.MustParse("1"),
+		JobCompute: adminv1.ComputeResources{
+			CPU: resource.MustParse("5"),
+		},
+	}
+	limits := adminv1.QuotaRequestResources{
+		CPU: resource.MustParse("2"),
+		JobCompute: adminv1.ComputeResources{
+			CPU: resource.MustParse("4"),
+		},
+	}
+
+	violations := exceedsLimits(used, limits)
+	if len(violations) != 1 {
+		t.Fatalf("expected exactly one job cpu violation, got %v", violations)
+	}
+}
+
+func TestExceedsLimitsExtendedResources(t *testing.T) {
+	used := adminv1.QuotaRequestResources{
+		ExtendedResources: map[corev1.ResourceName]resource.Quantity{
+			"nvidia.com/gpu": resource.MustParse("2"),
+		},
+	}
+	limits := adminv1.QuotaRequestResources{
+		ExtendedResources: map[corev1.ResourceName]resource.Quantity{
+			"nvidia.com/gpu": resource.MustParse("1"),
+		},
+	}
+
+	violations := exceedsLimits(used, limits)
+	if len(violations) != 1 {
+		t.Fatalf("expected exactly one extended resource violation, got %v", violations)
+	}
+}
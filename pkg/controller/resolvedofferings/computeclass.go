@@ -1,12 +1,16 @@
 package resolvedofferings
 
 import (
+	"maps"
+
 	"github.com/acorn-io/baaah/pkg/router"
 	apiv1 "github.com/acorn-io/runtime/pkg/apis/api.acorn.io/v1"
 	v1 "github.com/acorn-io/runtime/pkg/apis/internal.acorn.io/v1"
 	adminv1 "github.com/acorn-io/runtime/pkg/apis/internal.admin.acorn.io/v1"
 	"github.com/acorn-io/runtime/pkg/computeclasses"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // resolveComputeClasses resolves the compute class information for each container in the AppInstance
@@ -45,18 +49,20 @@ func resolveComputeClasses(req router.Request, cfg *apiv1.Config, appInstance *v
 		}
 		def := parsedMemory.Def.Value()
 		appInstance.Status.ResolvedOfferings.Containers[""] = v1.ContainerResolvedOffering{
-			Memory:    &def,
-			CPUScaler: &cc.CPUScaler,
-			Class:     appInstance.Status.ResolvedOfferings.Containers[""].Class,
+			Memory:            &def,
+			CPUScaler:         &cc.CPUScaler,
+			Class:             appInstance.Status.ResolvedOfferings.Containers[""].Class,
+			ExtendedResources: cc.ExtendedResources,
 		}
 	}
 
 	// Check to see if the user overrode the memory for all containers
 	if appInstance.Spec.Memory[""] != nil {
 		appInstance.Status.ResolvedOfferings.Containers[""] = v1.ContainerResolvedOffering{
-			Memory:    appInstance.Spec.Memory[""],
-			CPUScaler: appInstance.Status.ResolvedOfferings.Containers[""].CPUScaler,
-			Class:     appInstance.Status.ResolvedOfferings.Containers[""].Class,
+			Memory:            appInstance.Spec.Memory[""],
+			CPUScaler:         appInstance.Status.ResolvedOfferings.Containers[""].CPUScaler,
+			Class:             appInstance.Status.ResolvedOfferings.Containers[""].Class,
+			ExtendedResources: appInstance.Status.ResolvedOfferings.Containers[""].ExtendedResources,
 		}
 	}
 
@@ -115,20 +121,49 @@ func resolveComputeClass(req router.Request, appInstance *v1.AppInstance, config
 			memory = &def
 		}
 
+		// Determine the extended resource requests (gpu.nvidia.com, hugepages-2Mi, etc). These
+		// aren't user-overridable at runtime today, so the order of priority is just:
+		// 1. defaults in the acorn image
+		// 2. defaults from compute class
+		var ccExtendedResources map[corev1.ResourceName]resource.Quantity
+		if cc != nil {
+			ccExtendedResources = cc.ExtendedResources
+		}
+		extendedResources := mergeExtendedResources(container.ExtendedResources, ccExtendedResources)
+
 		appInstance.Status.ResolvedOfferings.Containers[name] = v1.ContainerResolvedOffering{
-			Class:     ccName,
-			Memory:    memory,
-			CPUScaler: cpuScaler,
+			Class:             ccName,
+			Memory:            memory,
+			CPUScaler:         cpuScaler,
+			ExtendedResources: extendedResources,
 		}
 
 		for sidecarName := range container.Sidecars {
 			appInstance.Status.ResolvedOfferings.Containers[sidecarName] = v1.ContainerResolvedOffering{
-				Class:     ccName,
-				Memory:    memory,
-				CPUScaler: cpuScaler,
+				Class:             ccName,
+				Memory:            memory,
+				CPUScaler:         cpuScaler,
+				ExtendedResources: extendedResources,
 			}
 		}
 	}
 
 	return nil
 }
+
+// mergeExtendedResources merges a container's own extended resource requests (gpu.nvidia.com,
+// hugepages-2Mi, etc) with a compute class's defaults for the same keys. Unlike memory, extended
+// resources are independent per resource name, so this merges key-by-key instead of one map
+// replacing the other wholesale - otherwise a container declaring any extended resource of its own
+// would silently lose every other default the compute class would have contributed. container's
+// value for a given key always wins; ccDefaults only fills in keys container didn't set.
+func mergeExtendedResources(container, ccDefaults map[corev1.ResourceName]resource.Quantity) map[corev1.ResourceName]resource.Quantity {
+	merged := maps.Clone(ccDefaults)
+	for name, quantity := range container {
+		if merged == nil {
+			merged = map[corev1.ResourceName]resource.Quantity{}
+		}
+		merged[name] = quantity
+	}
+	return merged
+}
@@ -0,0 +1,71 @@
+package resolvedofferings
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestMergeExtendedResourcesContainerAndComputeClassEachSetDistinctKeys(t *testing.T) {
+	container := map[corev1.ResourceName]resource.Quantity{
+		"ephemeral-storage": resource.MustParse("1Gi"),
+	}
+	ccDefaults := map[corev1.ResourceName]resource.Quantity{
+		"nvidia.com/gpu": resource.MustParse("1"),
+	}
+
+	merged := mergeExtendedResources(container, ccDefaults)
+
+	if got, ok := merged["ephemeral-storage"]; !ok || got.Cmp(resource.MustParse("1Gi")) != 0 {
+		t.Fatalf("expected the container's own ephemeral-storage request to be kept, got %v (ok=%v)", got, ok)
+	}
+	if got, ok := merged["nvidia.com/gpu"]; !ok || got.Cmp(resource.MustParse("1")) != 0 {
+		t.Fatalf("expected the compute class's gpu default to still be contributed, got %v (ok=%v)", got, ok)
+	}
+}
+
+func TestMergeExtendedResourcesContainerValueWinsOnSameKey(t *testing.T) {
+	container := map[corev1.ResourceName]resource.Quantity{
+		"nvidia.com/gpu": resource.MustParse("2"),
+	}
+	ccDefaults := map[corev1.ResourceName]resource.Quantity{
+		"nvidia.com/gpu": resource.MustParse("1"),
+	}
+
+	merged := mergeExtendedResources(container, ccDefaults)
+
+	if got := merged["nvidia.com/gpu"]; got.Cmp(resource.MustParse("2")) != 0 {
+		t.Fatalf("expected the container's own value to win, got %v", got)
+	}
+}
+
+func TestMergeExtendedResourcesNilContainerUsesComputeClassDefaults(t *testing.T) {
+	ccDefaults := map[corev1.ResourceName]resource.Quantity{
+		"nvidia.com/gpu": resource.MustParse("1"),
+	}
+
+	merged := mergeExtendedResources(nil, ccDefaults)
+
+	if got := merged["nvidia.com/gpu"]; got.Cmp(resource.MustParse("1")) != 0 {
+		t.Fatalf("expected the compute class default to be used when the container sets nothing, got %v", got)
+	}
+}
+
+func TestMergeExtendedResourcesNoComputeClassUsesContainerOnly(t *testing.T) {
+	container := map[corev1.ResourceName]resource.Quantity{
+		"nvidia.com/gpu": resource.MustParse("1"),
+	}
+
+	merged := mergeExtendedResources(container, nil)
+
+	if got := merged["nvidia.com/gpu"]; got.Cmp(resource.MustParse("1")) != 0 {
+		t.Fatalf("expected the container's own request to be used when there's no compute class, got %v", got)
+	}
+}
+
+func TestMergeExtendedResourcesBothNilReturnsNil(t *testing.T) {
+	if merged := mergeExtendedResources(nil, nil); merged != nil {
+		t.Fatalf("expected nil when neither source sets anything, got %v", merged)
+	}
+}